@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AddAccount registers a new account with a running instance: it updates
+// in-memory state, persists the token through the store, and arms its
+// refresh timer, mirroring what initAccountHandlers does at startup.
+func (tm *TokenManager) AddAccount(ctx context.Context, accountID, token string) error {
+	tm.mutex.Lock()
+	if _, exists := tm.accounts[accountID]; exists {
+		tm.mutex.Unlock()
+		return fmt.Errorf("account %s already exists", accountID)
+	}
+
+	globalPolicy, err := tm.config.resolvedPolicy()
+	if err != nil {
+		tm.mutex.Unlock()
+		return fmt.Errorf("error parsing global refresh policy: %v", err)
+	}
+
+	now := time.Now()
+	handler := &AccountHandler{
+		accountID:     accountID,
+		token:         token,
+		policy:        globalPolicy,
+		firstIssuedAt: now,
+		lastServed:    now,
+	}
+	tm.accounts[accountID] = handler
+	tm.mutex.Unlock()
+
+	// The store, not tm.config.Accounts, is the source of truth once running:
+	// for FileStore this is what actually persists the new account, and it
+	// guards the same config.Accounts map with its own mutex, so tm must not
+	// write to that map directly here.
+	if err := tm.store.PutToken(ctx, accountID, token, time.Time{}, now); err != nil {
+		return fmt.Errorf("error persisting new account to store: %v", err)
+	}
+
+	tm.scheduleNextRefresh(accountID, handler)
+	tm.events.Publish(Event{Type: EventAccountAdded, AccountID: accountID})
+	return nil
+}
+
+// RemoveAccount stops auto-refresh for accountID and removes it from both
+// in-memory state and the store.
+func (tm *TokenManager) RemoveAccount(ctx context.Context, accountID string) error {
+	tm.mutex.Lock()
+	handler, exists := tm.accounts[accountID]
+	if !exists {
+		tm.mutex.Unlock()
+		return fmt.Errorf("account %s not found", accountID)
+	}
+	delete(tm.accounts, accountID)
+	tm.mutex.Unlock()
+
+	handler.mutex.Lock()
+	handler.removed = true
+	if handler.refreshTimer != nil {
+		handler.refreshTimer.Stop()
+	}
+	handler.mutex.Unlock()
+
+	if err := tm.store.DeleteToken(ctx, accountID); err != nil {
+		return fmt.Errorf("error removing account from store: %v", err)
+	}
+
+	tm.events.Publish(Event{Type: EventAccountRemoved, AccountID: accountID})
+	return nil
+}
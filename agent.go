@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// AgentConfig configures the Unix domain socket agent protocol, an
+// auth-gated alternative to the CORS-open HTTP port for co-located
+// processes. A zero-value AgentConfig (no SocketPath) disables the agent.
+type AgentConfig struct {
+	SocketPath string          `json:"socket_path"`
+	Auth       AgentAuthConfig `json:"auth"`
+}
+
+// AgentAuthConfig selects how a caller proves it's allowed to use the
+// socket. Scheme "secret" compares the handshake value against Secret.
+// Scheme "uid" ignores the handshake value and instead checks the
+// connecting process's real UID (via SO_PEERCRED) against the allowlist in
+// UIDAllowlistFile, one UID per line.
+type AgentAuthConfig struct {
+	Scheme           string `json:"scheme"`
+	Secret           string `json:"secret,omitempty"`
+	UIDAllowlistFile string `json:"uid_allowlist_file,omitempty"`
+}
+
+// writeFrame writes data as a 4-byte big-endian length prefix followed by
+// the bytes themselves, so a payload may freely contain newlines (e.g. a
+// multi-account "list" response).
+func writeFrame(w io.Writer, data []byte) error {
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(data)))
+	if _, err := w.Write(lenBuf[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readFrame reads a frame written by writeFrame.
+func readFrame(r io.Reader) ([]byte, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func okResponse(payload string) []byte {
+	return []byte("ok\n" + payload)
+}
+
+func errResponse(msg string) []byte {
+	return []byte("err\n" + msg)
+}
+
+// AgentServer exposes token retrieval over a Unix domain socket so
+// co-located processes can fetch tokens without going through the
+// network-facing, unauthenticated HTTP port.
+type AgentServer struct {
+	tm       *TokenManager
+	config   AgentConfig
+	listener *net.UnixListener
+}
+
+// NewAgentServer binds the Unix socket at config.SocketPath. Any stale
+// socket file left behind by a previous, uncleanly-shutdown instance is
+// removed first.
+func NewAgentServer(tm *TokenManager, config AgentConfig) (*AgentServer, error) {
+	os.Remove(config.SocketPath)
+
+	addr, err := net.ResolveUnixAddr("unix", config.SocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving agent socket path: %v", err)
+	}
+
+	listener, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on agent socket: %v", err)
+	}
+
+	return &AgentServer{tm: tm, config: config, listener: listener}, nil
+}
+
+// Serve accepts connections until ctx is done or the listener is closed.
+func (a *AgentServer) Serve(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		a.listener.Close()
+	}()
+
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				log.Printf("Error accepting agent connection: %v", err)
+				continue
+			}
+		}
+		go a.handleConn(conn.(*net.UnixConn))
+	}
+}
+
+// Close stops accepting new connections on the agent socket and removes the
+// socket file.
+func (a *AgentServer) Close() error {
+	err := a.listener.Close()
+	os.Remove(a.config.SocketPath)
+	return err
+}
+
+func (a *AgentServer) handleConn(conn *net.UnixConn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	if !a.authenticate(conn) {
+		writeFrame(conn, errResponse("authentication failed"))
+		return
+	}
+	writeFrame(conn, okResponse(""))
+
+	for {
+		frame, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+		response := a.dispatch(string(frame))
+		if err := writeFrame(conn, response); err != nil {
+			return
+		}
+	}
+}
+
+// authenticate consumes the mandatory `set-token <scheme> <value>` handshake
+// frame and validates it against the configured AgentAuthConfig.
+func (a *AgentServer) authenticate(conn *net.UnixConn) bool {
+	frame, err := readFrame(conn)
+	if err != nil {
+		return false
+	}
+
+	fields := strings.SplitN(string(frame), " ", 3)
+	if len(fields) < 2 || fields[0] != "set-token" {
+		return false
+	}
+	scheme := fields[1]
+	var value string
+	if len(fields) == 3 {
+		value = fields[2]
+	}
+
+	if scheme != a.config.Auth.Scheme {
+		return false
+	}
+
+	switch scheme {
+	case "secret":
+		return value != "" && value == a.config.Auth.Secret
+	case "uid":
+		return a.callerUIDAllowed(conn)
+	default:
+		return false
+	}
+}
+
+// callerUIDAllowed reads the real UID of the connected peer via SO_PEERCRED
+// and checks it against the allowlist file, rather than trusting anything
+// the client claims about itself.
+func (a *AgentServer) callerUIDAllowed(conn *net.UnixConn) bool {
+	allowed, err := loadUIDAllowlist(a.config.Auth.UIDAllowlistFile)
+	if err != nil {
+		log.Printf("Error loading UID allowlist: %v", err)
+		return false
+	}
+
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	var peerUID uint32
+	var credErr error
+	controlErr := rawConn.Control(func(fd uintptr) {
+		ucred, err := unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+		if err != nil {
+			credErr = err
+			return
+		}
+		peerUID = ucred.Uid
+	})
+	if controlErr != nil || credErr != nil {
+		return false
+	}
+
+	_, ok := allowed[peerUID]
+	return ok
+}
+
+func loadUIDAllowlist(path string) (map[uint32]struct{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading UID allowlist file: %v", err)
+	}
+
+	allowed := make(map[uint32]struct{})
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		uid, err := strconv.ParseUint(line, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UID %q in allowlist: %v", line, err)
+		}
+		allowed[uint32(uid)] = struct{}{}
+	}
+	return allowed, nil
+}
+
+// dispatch runs one protocol command and returns the response frame.
+func (a *AgentServer) dispatch(line string) []byte {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return errResponse("empty command")
+	}
+
+	switch fields[0] {
+	case "ping":
+		return okResponse("pong")
+
+	case "list":
+		return okResponse(strings.Join(a.listAccounts(), "\n"))
+
+	case "status":
+		return okResponse(strings.Join(a.accountStatus(), "\n"))
+
+	case "get-token":
+		if len(fields) != 2 {
+			return errResponse("usage: get-token <account_id>")
+		}
+		stored, err := a.tm.store.GetToken(context.Background(), fields[1])
+		if err != nil {
+			return errResponse(err.Error())
+		}
+		return okResponse(stored.Token)
+
+	case "refresh":
+		if len(fields) != 2 {
+			return errResponse("usage: refresh <account_id>")
+		}
+		if err := a.tm.manualRefresh(fields[1]); err != nil {
+			return errResponse(err.Error())
+		}
+		return okResponse("refreshed")
+
+	case "add-account":
+		if len(fields) != 3 {
+			return errResponse("usage: add-account <account_id> <token>")
+		}
+		if err := a.tm.AddAccount(context.Background(), fields[1], fields[2]); err != nil {
+			return errResponse(err.Error())
+		}
+		return okResponse("added")
+
+	case "remove-account":
+		if len(fields) != 2 {
+			return errResponse("usage: remove-account <account_id>")
+		}
+		if err := a.tm.RemoveAccount(context.Background(), fields[1]); err != nil {
+			return errResponse(err.Error())
+		}
+		return okResponse("removed")
+
+	default:
+		return errResponse("unknown command: " + fields[0])
+	}
+}
+
+func formatAgentTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// listAccounts returns one tab-separated line per account: ID, last
+// refresh, next scheduled refresh, and computed expiry.
+func (a *AgentServer) listAccounts() []string {
+	a.tm.mutex.RLock()
+	defer a.tm.mutex.RUnlock()
+
+	lines := make([]string, 0, len(a.tm.accounts))
+	for id, h := range a.tm.accounts {
+		h.mutex.RLock()
+		expiresAt := time.Time{}
+		if h.expiresIn > 0 {
+			expiresAt = h.lastRefresh.Add(h.expiresIn)
+		}
+		lines = append(lines, fmt.Sprintf("%s\tlast_refresh=%s\tnext_refresh=%s\texpires=%s",
+			id, formatAgentTime(h.lastRefresh), formatAgentTime(h.nextRefreshAt), formatAgentTime(expiresAt)))
+		h.mutex.RUnlock()
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// accountStatus returns one tab-separated health line per account.
+func (a *AgentServer) accountStatus() []string {
+	a.tm.mutex.RLock()
+	defer a.tm.mutex.RUnlock()
+
+	lines := make([]string, 0, len(a.tm.accounts))
+	for id, h := range a.tm.accounts {
+		h.mutex.RLock()
+		healthy := !h.rotationStopped && h.retryCount == 0
+		lines = append(lines, fmt.Sprintf("%s\thealthy=%t\tretry_count=%d\trotation_stopped=%t\tlast_served=%s",
+			id, healthy, h.retryCount, h.rotationStopped, formatAgentTime(h.lastServed)))
+		h.mutex.RUnlock()
+	}
+	sort.Strings(lines)
+	return lines
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+)
+
+// AgentClient speaks the Unix socket agent protocol from the client side,
+// used by the `instatokend agent` CLI subcommands.
+type AgentClient struct {
+	conn net.Conn
+}
+
+// DialAgent connects to socketPath and completes the `set-token` handshake
+// using authScheme/authValue (see AgentAuthConfig for what each scheme
+// expects).
+func DialAgent(socketPath, authScheme, authValue string) (*AgentClient, error) {
+	conn, err := net.DialTimeout("unix", socketPath, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to agent socket: %v", err)
+	}
+
+	client := &AgentClient{conn: conn}
+	if err := writeFrame(conn, []byte(fmt.Sprintf("set-token %s %s", authScheme, authValue))); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error sending handshake: %v", err)
+	}
+
+	status, _, err := client.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error reading handshake response: %v", err)
+	}
+	if status != "ok" {
+		conn.Close()
+		return nil, fmt.Errorf("agent authentication failed")
+	}
+
+	return client, nil
+}
+
+// Close closes the underlying connection.
+func (c *AgentClient) Close() error {
+	return c.conn.Close()
+}
+
+// Call sends command and returns its payload, or an error built from the
+// agent's "err" response.
+func (c *AgentClient) Call(command string) (string, error) {
+	if err := writeFrame(c.conn, []byte(command)); err != nil {
+		return "", fmt.Errorf("error sending command: %v", err)
+	}
+
+	status, payload, err := c.readResponse()
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %v", err)
+	}
+	if status != "ok" {
+		return "", fmt.Errorf("%s", payload)
+	}
+	return payload, nil
+}
+
+func (c *AgentClient) readResponse() (status, payload string, err error) {
+	frame, err := readFrame(c.conn)
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := bytes.SplitN(frame, []byte("\n"), 2)
+	status = string(parts[0])
+	if len(parts) == 2 {
+		payload = string(parts[1])
+	}
+	return status, payload, nil
+}
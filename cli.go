@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// cmdRefresh implements `instatokend refresh [-config path] <account_id>`:
+// a one-shot manual refresh outside the long-running server process.
+func cmdRefresh(args []string) {
+	cmd := flag.NewFlagSet("refresh", flag.ExitOnError)
+	configPath := cmd.String("config", defaultConfigPath, "path to config file")
+	cmd.Parse(args)
+
+	if cmd.NArg() != 1 {
+		log.Fatal("Usage: instatokend refresh [-config path/to/config.json] <account_id>")
+	}
+	accountID := cmd.Arg(0)
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	store, err := NewStore(config, *configPath)
+	if err != nil {
+		log.Fatalf("Error initializing token store: %v", err)
+	}
+	defer store.Close()
+
+	accounts, err := initAccountHandlers(context.Background(), store, config)
+	if err != nil {
+		log.Fatalf("Error initializing account handlers: %v", err)
+	}
+
+	tokenManager := &TokenManager{
+		accounts:   accounts,
+		config:     config,
+		store:      store,
+		events:     NewEventBus(),
+		configPath: *configPath,
+	}
+
+	if err := tokenManager.manualRefresh(accountID); err != nil {
+		log.Fatalf("Error refreshing token for %s: %v", accountID, err)
+	}
+
+	log.Printf("Successfully refreshed token for account: %s", accountID)
+}
+
+// cmdAgent dispatches `instatokend agent <subcommand> ...`.
+func cmdAgent(args []string) {
+	if len(args) < 1 {
+		log.Fatal("Usage: instatokend agent <get> ...")
+	}
+
+	switch args[0] {
+	case "get":
+		cmdAgentGet(args[1:])
+	default:
+		log.Fatalf("Unknown agent subcommand: %s", args[0])
+	}
+}
+
+// cmdAgentGet implements `instatokend agent get [-config path] <account_id>`,
+// fetching a token over the Unix socket agent protocol.
+func cmdAgentGet(args []string) {
+	cmd := flag.NewFlagSet("agent get", flag.ExitOnError)
+	configPath := cmd.String("config", defaultConfigPath, "path to config file")
+	cmd.Parse(args)
+
+	if cmd.NArg() != 1 {
+		log.Fatal("Usage: instatokend agent get [-config path/to/config.json] <account_id>")
+	}
+	accountID := cmd.Arg(0)
+
+	client := dialConfiguredAgent(*configPath)
+	defer client.Close()
+
+	token, err := client.Call("get-token " + accountID)
+	if err != nil {
+		log.Fatalf("Error fetching token for %s: %v", accountID, err)
+	}
+
+	fmt.Println(token)
+}
+
+// dialConfiguredAgent loads configPath and dials its agent socket, exiting
+// the process on any failure. Used by subcommands with no fallback for a
+// daemon that isn't running.
+func dialConfiguredAgent(configPath string) *AgentClient {
+	config, err := loadConfig(configPath)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	if config.Agent.SocketPath == "" {
+		log.Fatal("Agent socket is not configured in config.json")
+	}
+
+	client, err := DialAgent(config.Agent.SocketPath, config.Agent.Auth.Scheme, config.Agent.Auth.Secret)
+	if err != nil {
+		log.Fatalf("Error connecting to agent: %v", err)
+	}
+	return client
+}
+
+// tryDialConfiguredAgent is like dialConfiguredAgent but returns nil instead
+// of exiting when the agent isn't configured or isn't reachable, so callers
+// can carry on with config.json alone.
+func tryDialConfiguredAgent(config *Config) *AgentClient {
+	if config.Agent.SocketPath == "" {
+		return nil
+	}
+	client, err := DialAgent(config.Agent.SocketPath, config.Agent.Auth.Scheme, config.Agent.Auth.Secret)
+	if err != nil {
+		return nil
+	}
+	return client
+}
+
+// cmdAdd implements `instatokend add [-config path] --token=IG... <account_id>`:
+// it writes the account to config.json and, if a daemon is running, hot-adds
+// it via the agent socket so a restart isn't required.
+func cmdAdd(args []string) {
+	cmd := flag.NewFlagSet("add", flag.ExitOnError)
+	configPath := cmd.String("config", defaultConfigPath, "path to config file")
+	token := cmd.String("token", "", "Instagram access token (IG...)")
+	cmd.Parse(args)
+
+	if cmd.NArg() != 1 || *token == "" {
+		log.Fatal("Usage: instatokend add [-config path/to/config.json] --token=IG... <account_id>")
+	}
+	accountID := cmd.Arg(0)
+
+	if !regexp.MustCompile(validTokenPattern).MatchString(*token) {
+		log.Fatalf("Invalid token format for account %s", accountID)
+	}
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	if _, exists := config.Accounts[accountID]; exists {
+		log.Fatalf("Account %s already exists in %s", accountID, *configPath)
+	}
+	config.Accounts[accountID] = InstagramAccount{Token: *token}
+
+	data, err := marshalConfigFile(config)
+	if err != nil {
+		log.Fatalf("Error marshaling config: %v", err)
+	}
+	if err := os.WriteFile(*configPath, data, 0o644); err != nil {
+		log.Fatalf("Error writing config: %v", err)
+	}
+	log.Printf("Added account %s to %s", accountID, *configPath)
+
+	client := tryDialConfiguredAgent(config)
+	if client == nil {
+		log.Printf("Running instance not reachable; restart instatokend to pick up account %s", accountID)
+		return
+	}
+	defer client.Close()
+
+	if _, err := client.Call(fmt.Sprintf("add-account %s %s", accountID, *token)); err != nil {
+		log.Printf("Warning: added to config but failed to hot-add via running instance: %v", err)
+		return
+	}
+	log.Printf("Hot-added account %s to the running instance", accountID)
+}
+
+// cmdRemove implements `instatokend remove [-config path] <account_id>`: it
+// removes the account from config.json and, if a daemon is running,
+// hot-removes it via the agent socket.
+func cmdRemove(args []string) {
+	cmd := flag.NewFlagSet("remove", flag.ExitOnError)
+	configPath := cmd.String("config", defaultConfigPath, "path to config file")
+	cmd.Parse(args)
+
+	if cmd.NArg() != 1 {
+		log.Fatal("Usage: instatokend remove [-config path/to/config.json] <account_id>")
+	}
+	accountID := cmd.Arg(0)
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	if _, exists := config.Accounts[accountID]; !exists {
+		log.Fatalf("Account %s not found in %s", accountID, *configPath)
+	}
+	delete(config.Accounts, accountID)
+
+	data, err := marshalConfigFile(config)
+	if err != nil {
+		log.Fatalf("Error marshaling config: %v", err)
+	}
+	if err := os.WriteFile(*configPath, data, 0o644); err != nil {
+		log.Fatalf("Error writing config: %v", err)
+	}
+	log.Printf("Removed account %s from %s", accountID, *configPath)
+
+	client := tryDialConfiguredAgent(config)
+	if client == nil {
+		log.Printf("Running instance not reachable; restart instatokend to stop refreshing account %s", accountID)
+		return
+	}
+	defer client.Close()
+
+	if _, err := client.Call("remove-account " + accountID); err != nil {
+		log.Printf("Warning: removed from config but failed to hot-remove via running instance: %v", err)
+		return
+	}
+	log.Printf("Hot-removed account %s from the running instance", accountID)
+}
+
+// cmdList implements `instatokend list [-config path]`. It prefers the live
+// view from a running daemon's agent socket and falls back to the account
+// IDs in config.json when the daemon isn't reachable.
+func cmdList(args []string) {
+	cmd := flag.NewFlagSet("list", flag.ExitOnError)
+	configPath := cmd.String("config", defaultConfigPath, "path to config file")
+	cmd.Parse(args)
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	if client := tryDialConfiguredAgent(config); client != nil {
+		defer client.Close()
+		payload, err := client.Call("list")
+		if err == nil {
+			fmt.Println(payload)
+			return
+		}
+		log.Printf("Warning: running instance returned an error, falling back to config.json: %v", err)
+	}
+
+	ids := make([]string, 0, len(config.Accounts))
+	for id := range config.Accounts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Println(id)
+	}
+}
+
+// cmdStatus implements `instatokend status [-config path]`. Health is only
+// meaningful for a running instance, so unlike cmdList this has no
+// config.json fallback.
+func cmdStatus(args []string) {
+	cmd := flag.NewFlagSet("status", flag.ExitOnError)
+	configPath := cmd.String("config", defaultConfigPath, "path to config file")
+	cmd.Parse(args)
+
+	client := dialConfiguredAgent(*configPath)
+	defer client.Close()
+
+	payload, err := client.Call("status")
+	if err != nil {
+		log.Fatalf("Error fetching status: %v", err)
+	}
+	fmt.Println(payload)
+}
+
+// cmdValidate implements
+// `instatokend validate [-config path] --retry-timeout=10m --sleep=15s`:
+// it force-refreshes every configured account, retrying failures until every
+// account has succeeded once or retryTimeout elapses.
+func cmdValidate(args []string) {
+	cmd := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := cmd.String("config", defaultConfigPath, "path to config file")
+	retryTimeout := cmd.Duration("retry-timeout", 10*time.Minute, "give up retrying after this long")
+	sleep := cmd.Duration("sleep", 15*time.Second, "delay between retry passes")
+	cmd.Parse(args)
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	if err := validateConfig(config); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	store, err := NewStore(config, *configPath)
+	if err != nil {
+		log.Fatalf("Error initializing token store: %v", err)
+	}
+	defer store.Close()
+
+	accounts, err := initAccountHandlers(context.Background(), store, config)
+	if err != nil {
+		log.Fatalf("Error initializing account handlers: %v", err)
+	}
+
+	tokenManager := &TokenManager{
+		accounts:   accounts,
+		config:     config,
+		store:      store,
+		events:     NewEventBus(),
+		configPath: *configPath,
+	}
+
+	pending := make(map[string]bool, len(accounts))
+	for id := range accounts {
+		pending[id] = true
+	}
+
+	deadline := time.Now().Add(*retryTimeout)
+	for attempt := 1; len(pending) > 0; attempt++ {
+		for id := range pending {
+			if err := tokenManager.refreshToken(context.Background(), id, accounts[id]); err != nil {
+				log.Printf("validate: attempt %d: %s failed: %v", attempt, id, err)
+				continue
+			}
+			log.Printf("validate: %s refreshed successfully", id)
+			delete(pending, id)
+		}
+
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			log.Fatalf("validate: timed out after %s with %d account(s) still failing: %v",
+				*retryTimeout, len(pending), pendingAccountIDs(pending))
+		}
+		time.Sleep(*sleep)
+	}
+
+	log.Printf("validate: all %d account(s) refreshed successfully", len(accounts))
+}
+
+func pendingAccountIDs(pending map[string]bool) []string {
+	ids := make([]string, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies a token lifecycle event published on the EventBus.
+type EventType string
+
+const (
+	EventTokenRefreshed     EventType = "token_refreshed"
+	EventTokenRefreshFailed EventType = "token_refresh_failed"
+	EventTokenNearExpiry    EventType = "token_near_expiry"
+	EventMaxRetriesExceeded EventType = "max_retries_exceeded"
+	EventAccountAdded       EventType = "account_added"
+	EventAccountRemoved     EventType = "account_removed"
+)
+
+// Event describes a single token lifecycle occurrence for one account.
+type Event struct {
+	Type      EventType  `json:"type"`
+	AccountID string     `json:"account_id"`
+	Timestamp time.Time  `json:"timestamp"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// EventSink receives every event published on an EventBus. Handle must not
+// block the publisher; sinks that do network I/O should hand off to a
+// goroutine of their own.
+type EventSink interface {
+	Handle(event Event)
+}
+
+// EventBus fans a TokenManager's lifecycle events out to SSE subscribers
+// (the /events endpoint) and any configured EventSinks (webhooks).
+type EventBus struct {
+	mutex       sync.RWMutex
+	subscribers map[chan Event]struct{}
+	sinks       []EventSink
+}
+
+// NewEventBus returns an EventBus with no subscribers or sinks yet.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// AddSink registers sink to receive every future published event.
+func (b *EventBus) AddSink(sink EventSink) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.sinks = append(b.sinks, sink)
+}
+
+// Publish stamps event with the current time and delivers it to every
+// subscriber and sink. Subscribers that can't keep up have the event
+// dropped for them rather than stalling the publisher.
+func (b *EventBus) Publish(event Event) {
+	event.Timestamp = time.Now()
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+
+	for _, sink := range b.sinks {
+		go sink.Handle(event)
+	}
+}
+
+// Subscribe registers a new listener for the /events endpoint. The returned
+// func must be called to unregister the listener and release its channel.
+func (b *EventBus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 16)
+
+	b.mutex.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mutex.Unlock()
+
+	unsubscribe := func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// Close disconnects every current subscriber, e.g. so SSE clients see their
+// connection end cleanly during server shutdown.
+func (b *EventBus) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for ch := range b.subscribers {
+		close(ch)
+		delete(b.subscribers, ch)
+	}
+}
@@ -25,13 +25,25 @@ const (
 )
 
 type InstagramAccount struct {
-	Token string `json:"token"`
+	Token         string              `json:"token"`
+	RefreshPolicy RefreshPolicyConfig `json:"refresh_policy,omitempty"`
+	FirstIssuedAt time.Time           `json:"first_issued_at,omitempty"`
+	ExpiresAt     time.Time           `json:"expires_at,omitempty"`
 }
 
 type Config struct {
-	Accounts    map[string]InstagramAccount `json:"-"`
-	RefreshFreq string                      `json:"refresh_freq"`
-	Port        string                      `json:"port"`
+	Accounts      map[string]InstagramAccount `json:"-"`
+	RefreshFreq   string                      `json:"refresh_freq"`
+	Port          string                      `json:"port"`
+	Storage       StorageConfig               `json:"storage"`
+	RefreshPolicy RefreshPolicyConfig         `json:"refresh_policy"`
+	Webhooks      []WebhookTarget             `json:"webhooks"`
+	Agent         AgentConfig                 `json:"agent"`
+}
+
+// resolvedPolicy returns the global RefreshPolicy, parsed from config.json.
+func (c *Config) resolvedPolicy() (RefreshPolicy, error) {
+	return resolveRefreshPolicy(RefreshPolicy{}, c.RefreshPolicy)
 }
 
 type TokenResponse struct {
@@ -42,20 +54,32 @@ type TokenResponse struct {
 }
 
 type TokenManager struct {
-	accounts   map[string]*AccountHandler
-	config     *Config
-	server     *http.Server
-	configPath string
-	mutex      sync.RWMutex
+	accounts    map[string]*AccountHandler
+	config      *Config
+	store       Store
+	events      *EventBus
+	server      *http.Server
+	agentServer *AgentServer
+	watchCancel context.CancelFunc
+	watchDone   chan struct{}
+	configPath  string
+	mutex       sync.RWMutex
 }
 
 type AccountHandler struct {
-	lastRefresh  time.Time
-	refreshTimer *time.Timer
-	accountID    string
-	token        string
-	retryCount   int
-	mutex        sync.RWMutex
+	lastRefresh     time.Time
+	lastServed      time.Time
+	firstIssuedAt   time.Time
+	nextRefreshAt   time.Time
+	refreshTimer    *time.Timer
+	accountID       string
+	token           string
+	expiresIn       time.Duration
+	retryCount      int
+	policy          RefreshPolicy
+	rotationStopped bool
+	removed         bool
+	mutex           sync.RWMutex
 }
 
 func getDuration(freq string) time.Duration {
@@ -88,6 +112,11 @@ func validateConfig(config *Config) error {
 		}
 	}
 
+	// Validate storage backend configuration
+	if err := validateStorageConfig(config.Storage); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -100,7 +129,7 @@ func (tm *TokenManager) refreshTokenWithRetry(ctx context.Context, accountID str
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			err = tm.refreshToken(accountID, handler)
+			err = tm.refreshToken(ctx, accountID, handler)
 			if err == nil {
 				handler.mutex.Lock()
 				handler.retryCount = 0
@@ -115,6 +144,7 @@ func (tm *TokenManager) refreshTokenWithRetry(ctx context.Context, accountID str
 
 			if retryCount >= maxRetries {
 				log.Printf("Maximum retry attempts reached for account %s: %v", accountID, err)
+				tm.events.Publish(Event{Type: EventMaxRetriesExceeded, AccountID: accountID, Error: err.Error()})
 				return fmt.Errorf("max retries exceeded: %v", err)
 			}
 
@@ -127,9 +157,10 @@ func (tm *TokenManager) refreshTokenWithRetry(ctx context.Context, accountID str
 	return err
 }
 
-func (tm *TokenManager) refreshToken(accountID string, handler *AccountHandler) error {
+func (tm *TokenManager) refreshToken(ctx context.Context, accountID string, handler *AccountHandler) error {
 	handler.mutex.RLock()
 	currentToken := handler.token
+	firstIssuedAt := handler.firstIssuedAt
 	handler.mutex.RUnlock()
 
 	client := &http.Client{
@@ -138,31 +169,42 @@ func (tm *TokenManager) refreshToken(accountID string, handler *AccountHandler)
 
 	resp, err := client.Get("https://graph.instagram.com/refresh_access_token?grant_type=ig_refresh_token&access_token=" + currentToken)
 	if err != nil {
+		tm.events.Publish(Event{Type: EventTokenRefreshFailed, AccountID: accountID, Error: err.Error()})
 		return fmt.Errorf("error making request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
-	} else {
-		log.Printf("Token successfully refreshed for account: %s", accountID)
+		err := fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
+		tm.events.Publish(Event{Type: EventTokenRefreshFailed, AccountID: accountID, Error: err.Error()})
+		return err
 	}
+	log.Printf("Token successfully refreshed for account: %s", accountID)
 
 	var tokenResp TokenResponse
 	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		tm.events.Publish(Event{Type: EventTokenRefreshFailed, AccountID: accountID, Error: err.Error()})
 		return fmt.Errorf("error parsing response: %v", err)
 	}
 
+	expiresIn := time.Duration(tokenResp.ExpiresIn) * time.Second
+	expiresAt := time.Now().Add(expiresIn)
+
 	handler.mutex.Lock()
 	handler.token = tokenResp.NewToken
 	handler.lastRefresh = time.Now()
+	handler.expiresIn = expiresIn
 	handler.mutex.Unlock()
 
-	// Save updated tokens to config
-	if err := saveConfig(tm.config, tm); err != nil {
-		log.Printf("Warning: Failed to save updated token to config: %v", err)
+	// Persist the refreshed token through the configured store so other
+	// instances sharing it converge on the new value. firstIssuedAt travels
+	// along unchanged so AbsoluteLifetime survives a process restart.
+	if err := tm.store.PutToken(ctx, accountID, tokenResp.NewToken, expiresAt, firstIssuedAt); err != nil {
+		log.Printf("Warning: Failed to persist updated token to store: %v", err)
 	}
 
+	tm.events.Publish(Event{Type: EventTokenRefreshed, AccountID: accountID, ExpiresAt: &expiresAt})
+
 	return nil
 }
 
@@ -174,7 +216,49 @@ func (tm *TokenManager) scheduleNextRefresh(accountID string, handler *AccountHa
 		handler.refreshTimer.Stop()
 	}
 
+	// RemoveAccount may have torn this handler down concurrently (e.g. a
+	// watchStore update was already in flight); don't resurrect its timer.
+	if handler.removed {
+		return
+	}
+
+	if handler.policy.DisableRotation {
+		log.Printf("Rotation disabled for account %s: serving static token only", accountID)
+		handler.nextRefreshAt = time.Time{}
+		return
+	}
+
+	if limit := handler.policy.AbsoluteLifetime; limit > 0 && time.Since(handler.firstIssuedAt) > limit {
+		log.Printf("Account %s exceeded absolute token lifetime (%s): stopping auto-refresh", accountID, limit)
+		handler.rotationStopped = true
+		handler.nextRefreshAt = time.Time{}
+		return
+	}
+
+	if window := handler.policy.ValidIfNotUsedFor; window > 0 && time.Since(handler.lastServed) > window {
+		log.Printf("Account %s not served in over %s: stopping auto-refresh until next request", accountID, window)
+		handler.rotationStopped = true
+		handler.nextRefreshAt = time.Time{}
+		return
+	}
+
+	handler.rotationStopped = false
 	refreshInterval := getDuration(tm.config.RefreshFreq)
+	if handler.expiresIn > 0 {
+		untilExpiry := handler.expiresIn - safetyMargin
+		if untilExpiry < time.Minute {
+			untilExpiry = time.Minute
+		}
+		if untilExpiry < refreshInterval {
+			refreshInterval = untilExpiry
+			if untilExpiry < 2*safetyMargin {
+				expiresAt := time.Now().Add(handler.expiresIn)
+				tm.events.Publish(Event{Type: EventTokenNearExpiry, AccountID: accountID, ExpiresAt: &expiresAt})
+			}
+		}
+	}
+
+	handler.nextRefreshAt = time.Now().Add(refreshInterval)
 	handler.refreshTimer = time.AfterFunc(refreshInterval, func() {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 		defer cancel()
@@ -202,11 +286,35 @@ func (tm *TokenManager) Shutdown(ctx context.Context) error {
 	}
 	tm.mutex.RUnlock()
 
-	// Save final state
-	if err := saveConfig(tm.config, tm); err != nil {
-		log.Printf("Error saving config during shutdown: %v", err)
+	// Stop watching the store for peer-pushed token updates, and wait for
+	// that goroutine to actually exit before closing the store out from
+	// under it (bounded by ctx so a stuck watch can't hang shutdown).
+	if tm.watchCancel != nil {
+		tm.watchCancel()
+	}
+	if tm.watchDone != nil {
+		select {
+		case <-tm.watchDone:
+		case <-ctx.Done():
+		}
+	}
+
+	// Release the store (flushing any buffered state, closing connections)
+	if err := tm.store.Close(); err != nil {
+		log.Printf("Error closing token store during shutdown: %v", err)
+	}
+
+	// Drain the agent socket listener alongside the HTTP one
+	if tm.agentServer != nil {
+		if err := tm.agentServer.Close(); err != nil {
+			log.Printf("Error closing agent socket: %v", err)
+		}
 	}
 
+	// Disconnect any /events subscribers so they see a clean stream close
+	// rather than a dangling connection.
+	tm.events.Close()
+
 	// Shutdown HTTP server
 	return tm.server.Shutdown(ctx)
 }
@@ -226,6 +334,51 @@ func (tm *TokenManager) setupRefreshes() {
 	log.Printf("Individual refresh timers set up for all accounts")
 }
 
+// watchStore applies token updates pushed by Store.Watch to local state, so
+// a standby instance sharing a live backend (etcd, Postgres) converges on a
+// peer's refresh instead of independently firing its own against Instagram
+// on its own stale schedule. Backends with no live-update support (file)
+// return a nil channel, in which case this is a no-op.
+func (tm *TokenManager) watchStore(ctx context.Context) {
+	updates, err := tm.store.Watch(ctx)
+	if err != nil {
+		log.Printf("Error starting store watch: %v", err)
+		return
+	}
+	if updates == nil {
+		return
+	}
+
+	for update := range updates {
+		tm.mutex.RLock()
+		handler, exists := tm.accounts[update.AccountID]
+		tm.mutex.RUnlock()
+		if !exists {
+			continue
+		}
+
+		handler.mutex.Lock()
+		if handler.token == update.Token.Token {
+			handler.mutex.Unlock()
+			continue
+		}
+		handler.token = update.Token.Token
+		handler.lastRefresh = time.Now()
+		if !update.Token.ExpiresAt.IsZero() {
+			handler.expiresIn = time.Until(update.Token.ExpiresAt)
+		}
+		if !update.Token.FirstIssuedAt.IsZero() {
+			handler.firstIssuedAt = update.Token.FirstIssuedAt
+		}
+		handler.mutex.Unlock()
+
+		log.Printf("Token for account %s converged from a peer refresh", update.AccountID)
+		expiresAt := update.Token.ExpiresAt
+		tm.events.Publish(Event{Type: EventTokenRefreshed, AccountID: update.AccountID, ExpiresAt: &expiresAt})
+		tm.scheduleNextRefresh(update.AccountID, handler)
+	}
+}
+
 func loadConfig(configPath string) (*Config, error) {
 	file, err := os.ReadFile(configPath)
 	if err != nil {
@@ -248,10 +401,31 @@ func loadConfig(configPath string) (*Config, error) {
 	if port, ok := rawConfig["port"]; ok {
 		json.Unmarshal(port, &config.Port)
 	}
+	if storage, ok := rawConfig["storage"]; ok {
+		if err := json.Unmarshal(storage, &config.Storage); err != nil {
+			return nil, fmt.Errorf("error parsing storage config: %v", err)
+		}
+	}
+	if policy, ok := rawConfig["refresh_policy"]; ok {
+		if err := json.Unmarshal(policy, &config.RefreshPolicy); err != nil {
+			return nil, fmt.Errorf("error parsing refresh policy: %v", err)
+		}
+	}
+	if webhooks, ok := rawConfig["webhooks"]; ok {
+		if err := json.Unmarshal(webhooks, &config.Webhooks); err != nil {
+			return nil, fmt.Errorf("error parsing webhooks: %v", err)
+		}
+	}
+	if agent, ok := rawConfig["agent"]; ok {
+		if err := json.Unmarshal(agent, &config.Agent); err != nil {
+			return nil, fmt.Errorf("error parsing agent config: %v", err)
+		}
+	}
 
 	// Extract Instagram accounts
 	for key, value := range rawConfig {
-		if key != "refresh_freq" && key != "port" {
+		if key != "refresh_freq" && key != "port" && key != "storage" && key != "refresh_policy" &&
+			key != "webhooks" && key != "agent" {
 			var account InstagramAccount
 			if err := json.Unmarshal(value, &account); err != nil {
 				return nil, fmt.Errorf("error parsing account %s: %v", key, err)
@@ -271,30 +445,6 @@ func loadConfig(configPath string) (*Config, error) {
 	return config, nil
 }
 
-func saveConfig(config *Config, tokenManager *TokenManager) error {
-	// Create the output structure
-	output := make(map[string]interface{})
-	output["refresh_freq"] = config.RefreshFreq
-	output["port"] = config.Port
-
-	// Add all account tokens
-	tokenManager.mutex.RLock()
-	for id, handler := range tokenManager.accounts {
-		handler.mutex.RLock()
-		output[id] = InstagramAccount{Token: handler.token}
-		handler.mutex.RUnlock()
-	}
-	tokenManager.mutex.RUnlock()
-
-	// Save to file
-	data, err := json.MarshalIndent(output, "", "  ")
-	if err != nil {
-		return fmt.Errorf("error marshaling config: %v", err)
-	}
-
-	return os.WriteFile(tokenManager.configPath, data, 0o644)
-}
-
 func enableCORS(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -334,77 +484,119 @@ func (tm *TokenManager) handleGetToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	handler.mutex.RLock()
-	response := map[string]string{"token": handler.token}
-	handler.mutex.RUnlock()
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-}
+	// Read through the store rather than the local handler cache so that a
+	// standby instance serves a token rotated by whichever peer refreshed it.
+	stored, err := tm.store.GetToken(r.Context(), accountID)
+	if err != nil {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	}
 
-func (tm *TokenManager) manualRefresh(accountID string) error {
-	tm.mutex.RLock()
-	handler, exists := tm.accounts[accountID]
-	tm.mutex.RUnlock()
+	handler.mutex.Lock()
+	handler.lastServed = time.Now()
+	resumeRotation := handler.rotationStopped
+	handler.mutex.Unlock()
 
-	if !exists {
-		return fmt.Errorf("account %s not found", accountID)
+	// A request coming in after ValidIfNotUsedFor stopped rotation means the
+	// account is active again: pick rotation back up.
+	if resumeRotation {
+		tm.scheduleNextRefresh(accountID, handler)
 	}
 
-	return tm.refreshToken(accountID, handler)
-}
-
-func main() {
-	var configPath string
+	response := map[string]string{"token": stored.Token}
 
-	refreshCmd := flag.NewFlagSet("refresh", flag.ExitOnError)
-	refreshConfigPath := refreshCmd.String("config", defaultConfigPath, "path to config file")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
 
-	// Main flags
-	flag.StringVar(&configPath, "config", defaultConfigPath, "path to config file")
-	flag.Parse()
+// initAccountHandlers seeds an AccountHandler per configured account from
+// whatever the store currently has on record, falling back to the token in
+// config.json for accounts the store hasn't seen yet.
+func initAccountHandlers(ctx context.Context, store Store, config *Config) (map[string]*AccountHandler, error) {
+	stored, err := store.LoadAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading tokens from store: %v", err)
+	}
 
-	// Parse initial arguments
-	if len(os.Args) > 1 && os.Args[1] == "refresh" {
-		refreshCmd.Parse(os.Args[2:])
+	globalPolicy, err := config.resolvedPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing global refresh policy: %v", err)
+	}
 
-		if refreshCmd.NArg() != 1 {
-			log.Fatal("Usage: instatokend refresh [-config path/to/config.json] <account_id>")
+	now := time.Now()
+	accounts := make(map[string]*AccountHandler, len(config.Accounts))
+	for id, account := range config.Accounts {
+		token := account.Token
+		var expiresAt time.Time
+		firstIssuedAt := now
+		seedStore := true
+		if tok, ok := stored[id]; ok {
+			token = tok.Token
+			expiresAt = tok.ExpiresAt
+			if !tok.FirstIssuedAt.IsZero() {
+				firstIssuedAt = tok.FirstIssuedAt
+				seedStore = false
+			}
 		}
 
-		accountID := refreshCmd.Arg(0)
-
-		// Load configuration
-		config, err := loadConfig(*refreshConfigPath)
+		policy, err := resolveRefreshPolicy(globalPolicy, account.RefreshPolicy)
 		if err != nil {
-			log.Fatalf("Error loading config: %v", err)
+			return nil, fmt.Errorf("error parsing refresh policy for account %s: %v", id, err)
 		}
 
-		// Initialize token manager
-		tokenManager := &TokenManager{
-			accounts:   make(map[string]*AccountHandler),
-			config:     config,
-			configPath: *refreshConfigPath,
+		handler := &AccountHandler{
+			accountID:     id,
+			token:         token,
+			policy:        policy,
+			firstIssuedAt: firstIssuedAt,
+			lastServed:    now,
 		}
-
-		// Initialize account handlers
-		for id, account := range config.Accounts {
-			tokenManager.accounts[id] = &AccountHandler{
-				accountID: id,
-				token:     account.Token,
+		if !expiresAt.IsZero() {
+			handler.expiresIn = time.Until(expiresAt)
+		}
+		accounts[id] = handler
+
+		// The store hasn't recorded a first-issue time for this account yet
+		// (a pre-existing config, or a backend seeing it for the first time):
+		// persist the one we just originated so the next restart doesn't
+		// reset AbsoluteLifetime's clock back to zero.
+		if seedStore {
+			if err := store.PutToken(ctx, id, token, expiresAt, firstIssuedAt); err != nil {
+				return nil, fmt.Errorf("error seeding first-issued time for account %s: %v", id, err)
 			}
 		}
+	}
+	return accounts, nil
+}
 
-		// Perform manual refresh
-		if err := tokenManager.manualRefresh(accountID); err != nil {
-			log.Fatalf("Error refreshing token for %s: %v", accountID, err)
-		}
+func (tm *TokenManager) manualRefresh(accountID string) error {
+	tm.mutex.RLock()
+	handler, exists := tm.accounts[accountID]
+	tm.mutex.RUnlock()
 
-		log.Printf("Successfully refreshed token for account: %s", accountID)
-		return
+	if !exists {
+		return fmt.Errorf("account %s not found", accountID)
+	}
+
+	handler.mutex.RLock()
+	policy := handler.policy
+	sinceLastRefresh := time.Since(handler.lastRefresh)
+	handler.mutex.RUnlock()
+
+	if policy.DisableRotation {
+		return nil
+	}
+	if policy.ReuseInterval > 0 && sinceLastRefresh < policy.ReuseInterval {
+		log.Printf("Skipping refresh for %s: within reuse interval (%s since last refresh)", accountID, sinceLastRefresh)
+		return nil
 	}
 
-	// Load configuration
+	return tm.refreshToken(context.Background(), accountID, handler)
+}
+
+// runServer loads configPath and runs the long-lived HTTP + agent socket
+// server until it receives SIGINT/SIGTERM.
+func runServer(configPath string) {
 	config, err := loadConfig(configPath)
 	if err != nil {
 		log.Fatalf("Error loading config: %v", err)
@@ -414,32 +606,65 @@ func main() {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
 
+	store, err := NewStore(config, configPath)
+	if err != nil {
+		log.Fatalf("Error initializing token store: %v", err)
+	}
+
+	accounts, err := initAccountHandlers(context.Background(), store, config)
+	if err != nil {
+		log.Fatalf("Error initializing account handlers: %v", err)
+	}
+
+	events := NewEventBus()
+	if len(config.Webhooks) > 0 {
+		events.AddSink(NewWebhookSink(config.Webhooks))
+	}
+
 	tokenManager := &TokenManager{
-		accounts:   make(map[string]*AccountHandler),
+		accounts:   accounts,
 		config:     config,
+		store:      store,
+		events:     events,
 		configPath: configPath,
 	}
 
-	// Initialize account handlers
-	for id, account := range config.Accounts {
-		tokenManager.accounts[id] = &AccountHandler{
-			accountID: id,
-			token:     account.Token,
-		}
-	}
-
 	// Set up HTTP server with timeouts
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token/", enableCORS(tokenManager.handleGetToken))
+	mux.HandleFunc("/events", enableCORS(tokenManager.handleEvents))
+
 	tokenManager.server = &http.Server{
-		Addr:         ":" + config.Port,
-		Handler:      http.HandlerFunc(enableCORS(tokenManager.handleGetToken)),
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:        ":" + config.Port,
+		Handler:     mux,
+		ReadTimeout: 15 * time.Second,
+		// No WriteTimeout: the /events SSE stream stays open indefinitely.
+		IdleTimeout: 60 * time.Second,
 	}
 
 	// Set up individual refresh timers
 	tokenManager.setupRefreshes()
 
+	// Watch the store for token updates pushed by other instances sharing it
+	watchCtx, watchCancel := context.WithCancel(context.Background())
+	tokenManager.watchCancel = watchCancel
+	tokenManager.watchDone = make(chan struct{})
+	go func() {
+		defer close(tokenManager.watchDone)
+		tokenManager.watchStore(watchCtx)
+	}()
+
+	// Start the Unix socket agent alongside the HTTP server, if configured
+	if config.Agent.SocketPath != "" {
+		agentServer, err := NewAgentServer(tokenManager, config.Agent)
+		if err != nil {
+			log.Fatalf("Error starting agent socket: %v", err)
+		}
+		tokenManager.agentServer = agentServer
+		go agentServer.Serve(context.Background())
+		log.Printf("Agent socket listening at %s", config.Agent.SocketPath)
+	}
+
 	// Graceful shutdown handling
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -461,3 +686,39 @@ func main() {
 		log.Fatalf("Error starting server: %v", err)
 	}
 }
+
+// main dispatches to a subcommand, falling back to running the server when
+// none is given (or only top-level flags are).
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "refresh":
+			cmdRefresh(os.Args[2:])
+			return
+		case "agent":
+			cmdAgent(os.Args[2:])
+			return
+		case "add":
+			cmdAdd(os.Args[2:])
+			return
+		case "remove":
+			cmdRemove(os.Args[2:])
+			return
+		case "list":
+			cmdList(os.Args[2:])
+			return
+		case "status":
+			cmdStatus(os.Args[2:])
+			return
+		case "validate":
+			cmdValidate(os.Args[2:])
+			return
+		}
+	}
+
+	var configPath string
+	flag.StringVar(&configPath, "config", defaultConfigPath, "path to config file")
+	flag.Parse()
+
+	runServer(configPath)
+}
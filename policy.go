@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// safetyMargin is subtracted from a token's remaining lifetime so a refresh
+// fires comfortably before Instagram considers the token expired.
+const safetyMargin = 24 * time.Hour
+
+// RefreshPolicyConfig is the JSON shape of a refresh policy, as set globally
+// in config.json's top-level "refresh_policy" or per-account to override it.
+// Durations are strings parsed with time.ParseDuration (e.g. "2160h" for 90
+// days); a field left empty inherits the global default.
+type RefreshPolicyConfig struct {
+	AbsoluteLifetime  string `json:"absolute_lifetime,omitempty"`
+	ValidIfNotUsedFor string `json:"valid_if_not_used_for,omitempty"`
+	ReuseInterval     string `json:"reuse_interval,omitempty"`
+
+	// DisableRotation is a *bool, like the duration fields use "" to mean
+	// unset, so an account can explicitly override a global
+	// disable_rotation: true back to false rather than only ever being able
+	// to turn rotation off.
+	DisableRotation *bool `json:"disable_rotation,omitempty"`
+}
+
+// RefreshPolicy is the resolved, account-specific policy governing whether
+// and how often an account's token is auto-refreshed.
+type RefreshPolicy struct {
+	// AbsoluteLifetime is the hard cap, measured from firstIssuedAt, past
+	// which the token is considered dead and auto-refresh stops entirely.
+	// Zero means no cap.
+	AbsoluteLifetime time.Duration
+
+	// ValidIfNotUsedFor stops auto-refresh once the token hasn't been served
+	// via /token/{id} for this long. Zero means never stop on this basis.
+	ValidIfNotUsedFor time.Duration
+
+	// ReuseInterval is the minimum time between refreshes; a manual refresh
+	// requested inside this window returns the current token unchanged.
+	ReuseInterval time.Duration
+
+	// DisableRotation serves the static configured token and never calls
+	// the refresh endpoint.
+	DisableRotation bool
+}
+
+func parsePolicyDuration(field, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", field, err)
+	}
+	return d, nil
+}
+
+// resolveRefreshPolicy parses cfg, falling back to each field of base for
+// anything cfg leaves unset. Pass a zero-value RefreshPolicyConfig for cfg
+// when an account has no override.
+func resolveRefreshPolicy(base RefreshPolicy, cfg RefreshPolicyConfig) (RefreshPolicy, error) {
+	policy := base
+
+	if cfg.AbsoluteLifetime != "" {
+		d, err := parsePolicyDuration("absolute_lifetime", cfg.AbsoluteLifetime)
+		if err != nil {
+			return RefreshPolicy{}, err
+		}
+		policy.AbsoluteLifetime = d
+	}
+	if cfg.ValidIfNotUsedFor != "" {
+		d, err := parsePolicyDuration("valid_if_not_used_for", cfg.ValidIfNotUsedFor)
+		if err != nil {
+			return RefreshPolicy{}, err
+		}
+		policy.ValidIfNotUsedFor = d
+	}
+	if cfg.ReuseInterval != "" {
+		d, err := parsePolicyDuration("reuse_interval", cfg.ReuseInterval)
+		if err != nil {
+			return RefreshPolicy{}, err
+		}
+		policy.ReuseInterval = d
+	}
+	if cfg.DisableRotation != nil {
+		policy.DisableRotation = *cfg.DisableRotation
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// StoredToken is the durable representation of a single account's token
+// state, as persisted by a Store implementation.
+type StoredToken struct {
+	Token         string    `json:"token"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	FirstIssuedAt time.Time `json:"first_issued_at"`
+}
+
+// TokenUpdate is delivered on a Store's Watch channel whenever an account's
+// token changes, whether refreshed locally or pushed by a peer instance
+// sharing the same backend.
+type TokenUpdate struct {
+	AccountID string
+	Token     StoredToken
+}
+
+// Store abstracts token persistence so the rest of instatokend doesn't care
+// whether tokens live in config.json, etcd, or Postgres. Implementations
+// must be safe for concurrent use.
+type Store interface {
+	// LoadAll returns every known account's current token state.
+	LoadAll(ctx context.Context) (map[string]StoredToken, error)
+
+	// PutToken persists a refreshed token for accountID. firstIssuedAt is the
+	// time the account's token lineage began (unchanged across refreshes) so
+	// RefreshPolicy.AbsoluteLifetime survives a process restart.
+	PutToken(ctx context.Context, accountID string, token string, expiresAt, firstIssuedAt time.Time) error
+
+	// GetToken returns the current token for accountID as seen by the store,
+	// which may be fresher than a local cache in multi-instance deployments.
+	GetToken(ctx context.Context, accountID string) (StoredToken, error)
+
+	// DeleteToken removes accountID's token, e.g. when the account is
+	// removed via the CLI or agent protocol.
+	DeleteToken(ctx context.Context, accountID string) error
+
+	// Watch streams token updates pushed by any instance sharing this store.
+	// Backends with no live-update support (the file backend) may return a
+	// nil channel.
+	Watch(ctx context.Context) (<-chan TokenUpdate, error)
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// StorageConfig selects and configures a Store backend from config.json.
+// Config is backend-specific and re-parsed by the selected backend's
+// constructor.
+type StorageConfig struct {
+	Type   string          `json:"type"`
+	Config json.RawMessage `json:"config"`
+}
+
+// NewStore builds the Store selected by cfg.Storage, defaulting to the file
+// backend so configs predating this option keep working unchanged.
+func NewStore(cfg *Config, configPath string) (Store, error) {
+	switch cfg.Storage.Type {
+	case "", "file":
+		return NewFileStore(configPath, cfg), nil
+	case "etcd":
+		return NewEtcdStore(cfg.Storage.Config)
+	case "postgres":
+		return NewPostgresStore(cfg.Storage.Config)
+	default:
+		return nil, fmt.Errorf("unknown storage type: %s", cfg.Storage.Type)
+	}
+}
+
+// validateStorageConfig checks that the configured backend has what it needs
+// to connect, without actually connecting.
+func validateStorageConfig(storage StorageConfig) error {
+	switch storage.Type {
+	case "", "file":
+		return nil
+	case "etcd":
+		var cfg EtcdConfig
+		if err := json.Unmarshal(storage.Config, &cfg); err != nil {
+			return fmt.Errorf("invalid etcd storage config: %v", err)
+		}
+		if len(cfg.Endpoints) == 0 {
+			return fmt.Errorf("etcd storage config requires at least one endpoint")
+		}
+		return nil
+	case "postgres":
+		var cfg PostgresConfig
+		if err := json.Unmarshal(storage.Config, &cfg); err != nil {
+			return fmt.Errorf("invalid postgres storage config: %v", err)
+		}
+		if cfg.DSN == "" {
+			return fmt.Errorf("postgres storage config requires a dsn")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown storage type: %s", storage.Type)
+	}
+}
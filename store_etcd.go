@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const etcdKeyPrefix = "instatokend/tokens/"
+
+// EtcdConfig configures the etcd backend, decoded from StorageConfig.Config.
+type EtcdConfig struct {
+	Endpoints   []string `json:"endpoints"`
+	DialTimeout string   `json:"dial_timeout"`
+	Username    string   `json:"username"`
+	Password    string   `json:"password"`
+	LeaseTTL    int64    `json:"lease_ttl_seconds"`
+}
+
+// EtcdStore persists tokens in etcd so multiple instatokend instances can
+// share live token state: whichever instance refreshes a token pushes it to
+// every other instance's Watch via a lease-backed key. Every key's lease is
+// kept alive for as long as the store is open, so leaseTTL only bounds how
+// long a token survives once the store that wrote it stops (Close, or the
+// process crashing) without DeleteToken having run, rather than doubling as
+// "this account stopped rotating, let the key lapse".
+type EtcdStore struct {
+	client   *clientv3.Client
+	leaseTTL int64
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	// leases holds each account's lease, granted once and reused (re-Put
+	// under the same lease ID) for every subsequent refresh, so accounts
+	// don't accumulate one lease and keep-alive goroutine per refresh.
+	mutex  sync.Mutex
+	leases map[string]clientv3.LeaseID
+}
+
+// NewEtcdStore dials etcd using cfg and returns a ready Store.
+func NewEtcdStore(rawCfg json.RawMessage) (*EtcdStore, error) {
+	var cfg EtcdConfig
+	if err := json.Unmarshal(rawCfg, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid etcd storage config: %v", err)
+	}
+	if len(cfg.Endpoints) == 0 {
+		return nil, fmt.Errorf("etcd storage config requires at least one endpoint")
+	}
+
+	dialTimeout := 5 * time.Second
+	if cfg.DialTimeout != "" {
+		d, err := time.ParseDuration(cfg.DialTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid etcd dial_timeout: %v", err)
+		}
+		dialTimeout = d
+	}
+
+	leaseTTL := cfg.LeaseTTL
+	if leaseTTL <= 0 {
+		leaseTTL = 60 * 60 * 24 * 90 // 90 days; long enough to outlive any token's lifetime
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		DialTimeout: dialTimeout,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to etcd: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EtcdStore{
+		client:   client,
+		leaseTTL: leaseTTL,
+		ctx:      ctx,
+		cancel:   cancel,
+		leases:   make(map[string]clientv3.LeaseID),
+	}, nil
+}
+
+func (s *EtcdStore) LoadAll(ctx context.Context) (map[string]StoredToken, error) {
+	resp, err := s.client.Get(ctx, etcdKeyPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("error listing tokens from etcd: %v", err)
+	}
+
+	out := make(map[string]StoredToken, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		accountID := string(kv.Key[len(etcdKeyPrefix):])
+		var tok StoredToken
+		if err := json.Unmarshal(kv.Value, &tok); err != nil {
+			return nil, fmt.Errorf("error decoding stored token for %s: %v", accountID, err)
+		}
+		out[accountID] = tok
+	}
+	return out, nil
+}
+
+func (s *EtcdStore) PutToken(ctx context.Context, accountID, token string, expiresAt, firstIssuedAt time.Time) error {
+	leaseID, err := s.leaseFor(ctx, accountID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(StoredToken{Token: token, ExpiresAt: expiresAt, FirstIssuedAt: firstIssuedAt})
+	if err != nil {
+		return fmt.Errorf("error marshaling token: %v", err)
+	}
+
+	_, err = s.client.Put(ctx, etcdKeyPrefix+accountID, string(data), clientv3.WithLease(leaseID))
+	if err != nil {
+		return fmt.Errorf("error writing token to etcd: %v", err)
+	}
+	return nil
+}
+
+// leaseFor returns accountID's lease, granting and keep-aliving a new one
+// the first time it's needed and reusing it on every later call. The lease
+// is kept alive for the life of the store rather than leaseTTL, because an
+// account whose rotation is disabled or paused (DisableRotation,
+// ValidIfNotUsedFor, AbsoluteLifetime) may never call PutToken again, and
+// GetToken/handleGetToken must keep serving its static token until the
+// account is explicitly removed, not 404 once a lease lapses. Holding
+// s.mutex across the Grant/KeepAlive round trip serializes concurrent first
+// writes for the same account so they can't each mint their own lease.
+func (s *EtcdStore) leaseFor(ctx context.Context, accountID string) (clientv3.LeaseID, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if leaseID, ok := s.leases[accountID]; ok {
+		return leaseID, nil
+	}
+
+	lease, err := s.client.Grant(ctx, s.leaseTTL)
+	if err != nil {
+		return 0, fmt.Errorf("error granting etcd lease: %v", err)
+	}
+
+	keepAlive, err := s.client.KeepAlive(s.ctx, lease.ID)
+	if err != nil {
+		return 0, fmt.Errorf("error starting etcd lease keep-alive: %v", err)
+	}
+	go func() {
+		for range keepAlive {
+		}
+	}()
+
+	s.leases[accountID] = lease.ID
+	return lease.ID, nil
+}
+
+func (s *EtcdStore) GetToken(ctx context.Context, accountID string) (StoredToken, error) {
+	resp, err := s.client.Get(ctx, etcdKeyPrefix+accountID)
+	if err != nil {
+		return StoredToken{}, fmt.Errorf("error reading token from etcd: %v", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return StoredToken{}, fmt.Errorf("account %s not found", accountID)
+	}
+
+	var tok StoredToken
+	if err := json.Unmarshal(resp.Kvs[0].Value, &tok); err != nil {
+		return StoredToken{}, fmt.Errorf("error decoding stored token for %s: %v", accountID, err)
+	}
+	return tok, nil
+}
+
+func (s *EtcdStore) DeleteToken(ctx context.Context, accountID string) error {
+	if _, err := s.client.Delete(ctx, etcdKeyPrefix+accountID); err != nil {
+		return fmt.Errorf("error deleting token from etcd: %v", err)
+	}
+
+	s.mutex.Lock()
+	lease, hadLease := s.leases[accountID]
+	delete(s.leases, accountID)
+	s.mutex.Unlock()
+
+	if hadLease {
+		if _, err := s.client.Revoke(s.ctx, lease); err != nil {
+			log.Printf("Error revoking etcd lease for removed account %s: %v", accountID, err)
+		}
+	}
+	return nil
+}
+
+// Watch streams token updates pushed by any instance writing to this etcd
+// cluster, so a standby sees a refresh its peer just performed.
+func (s *EtcdStore) Watch(ctx context.Context) (<-chan TokenUpdate, error) {
+	updates := make(chan TokenUpdate)
+
+	go func() {
+		defer close(updates)
+
+		watchChan := s.client.Watch(ctx, etcdKeyPrefix, clientv3.WithPrefix())
+		for resp := range watchChan {
+			for _, ev := range resp.Events {
+				if ev.Type != clientv3.EventTypePut {
+					continue
+				}
+
+				accountID := string(ev.Kv.Key[len(etcdKeyPrefix):])
+				var tok StoredToken
+				if err := json.Unmarshal(ev.Kv.Value, &tok); err != nil {
+					continue
+				}
+
+				select {
+				case updates <- TokenUpdate{AccountID: accountID, Token: tok}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return updates, nil
+}
+
+func (s *EtcdStore) Close() error {
+	s.cancel()
+	return s.client.Close()
+}
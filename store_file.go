@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileStore persists tokens to the JSON config file on disk. It has no
+// cross-instance coordination: Watch never delivers updates, so pointing two
+// instances at the same file means they race on writes rather than
+// converging, exactly as before this Store interface existed.
+type FileStore struct {
+	path   string
+	config *Config
+	mutex  sync.Mutex
+}
+
+// NewFileStore wraps config, writing back to path on every PutToken.
+func NewFileStore(path string, config *Config) *FileStore {
+	return &FileStore{path: path, config: config}
+}
+
+func (s *FileStore) LoadAll(ctx context.Context) (map[string]StoredToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	out := make(map[string]StoredToken, len(s.config.Accounts))
+	for id, account := range s.config.Accounts {
+		out[id] = StoredToken{Token: account.Token, ExpiresAt: account.ExpiresAt, FirstIssuedAt: account.FirstIssuedAt}
+	}
+	return out, nil
+}
+
+func (s *FileStore) PutToken(ctx context.Context, accountID, token string, expiresAt, firstIssuedAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	account := s.config.Accounts[accountID]
+	account.Token = token
+	account.ExpiresAt = expiresAt
+	account.FirstIssuedAt = firstIssuedAt
+	s.config.Accounts[accountID] = account
+
+	return s.save()
+}
+
+func (s *FileStore) GetToken(ctx context.Context, accountID string) (StoredToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	account, ok := s.config.Accounts[accountID]
+	if !ok {
+		return StoredToken{}, fmt.Errorf("account %s not found", accountID)
+	}
+	return StoredToken{Token: account.Token, ExpiresAt: account.ExpiresAt, FirstIssuedAt: account.FirstIssuedAt}, nil
+}
+
+func (s *FileStore) DeleteToken(ctx context.Context, accountID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.config.Accounts, accountID)
+	return s.save()
+}
+
+func (s *FileStore) Watch(ctx context.Context) (<-chan TokenUpdate, error) {
+	return nil, nil
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// save writes the full config back to disk. Callers must hold s.mutex.
+func (s *FileStore) save() error {
+	data, err := marshalConfigFile(s.config)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
+
+// marshalConfigFile renders config back into the flat config.json shape
+// loadConfig expects: the well-known top-level keys alongside one entry per
+// account, keyed by account ID. Shared by FileStore and the CLI's add/remove
+// commands so both stay byte-for-byte consistent with what loadConfig reads.
+func marshalConfigFile(config *Config) ([]byte, error) {
+	output := make(map[string]interface{})
+	output["refresh_freq"] = config.RefreshFreq
+	output["port"] = config.Port
+	output["storage"] = config.Storage
+	output["refresh_policy"] = config.RefreshPolicy
+	output["webhooks"] = config.Webhooks
+	output["agent"] = config.Agent
+	for id, account := range config.Accounts {
+		output[id] = account
+	}
+
+	data, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling config: %v", err)
+	}
+	return data, nil
+}
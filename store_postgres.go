@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS instatokend_tokens (
+	account_id TEXT PRIMARY KEY,
+	token TEXT NOT NULL,
+	expires_at TIMESTAMPTZ,
+	first_issued_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// PostgresConfig configures the Postgres backend, decoded from
+// StorageConfig.Config.
+type PostgresConfig struct {
+	DSN         string `json:"dsn"`
+	MaxOpenConn int    `json:"max_open_conns"`
+}
+
+// PostgresStore persists tokens in a Postgres table so multiple instatokend
+// instances can share live token state. Unlike EtcdStore, Watch is
+// implemented by polling rather than LISTEN/NOTIFY, to keep the schema to a
+// single table; peers converge within pollInterval of a refresh.
+type PostgresStore struct {
+	db           *sql.DB
+	pollInterval time.Duration
+}
+
+// NewPostgresStore opens db using cfg and ensures the tokens table exists.
+func NewPostgresStore(rawCfg json.RawMessage) (*PostgresStore, error) {
+	var cfg PostgresConfig
+	if err := json.Unmarshal(rawCfg, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid postgres storage config: %v", err)
+	}
+	if cfg.DSN == "" {
+		return nil, fmt.Errorf("postgres storage config requires a dsn")
+	}
+
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("error opening postgres connection: %v", err)
+	}
+	if cfg.MaxOpenConn > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConn)
+	}
+
+	if _, err := db.Exec(postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error ensuring postgres schema: %v", err)
+	}
+
+	return &PostgresStore{db: db, pollInterval: 10 * time.Second}, nil
+}
+
+func (s *PostgresStore) LoadAll(ctx context.Context) (map[string]StoredToken, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT account_id, token, expires_at, first_issued_at FROM instatokend_tokens`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing tokens from postgres: %v", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]StoredToken)
+	for rows.Next() {
+		var accountID string
+		var tok StoredToken
+		var expiresAt, firstIssuedAt sql.NullTime
+		if err := rows.Scan(&accountID, &tok.Token, &expiresAt, &firstIssuedAt); err != nil {
+			return nil, fmt.Errorf("error scanning token row: %v", err)
+		}
+		if expiresAt.Valid {
+			tok.ExpiresAt = expiresAt.Time
+		}
+		if firstIssuedAt.Valid {
+			tok.FirstIssuedAt = firstIssuedAt.Time
+		}
+		out[accountID] = tok
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) PutToken(ctx context.Context, accountID, token string, expiresAt, firstIssuedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO instatokend_tokens (account_id, token, expires_at, first_issued_at, updated_at)
+		VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (account_id) DO UPDATE
+		SET token = $2, expires_at = $3, first_issued_at = $4, updated_at = now()`,
+		accountID, token, expiresAt, firstIssuedAt)
+	if err != nil {
+		return fmt.Errorf("error writing token to postgres: %v", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) GetToken(ctx context.Context, accountID string) (StoredToken, error) {
+	var tok StoredToken
+	var expiresAt, firstIssuedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT token, expires_at, first_issued_at FROM instatokend_tokens WHERE account_id = $1`, accountID).
+		Scan(&tok.Token, &expiresAt, &firstIssuedAt)
+	if err == sql.ErrNoRows {
+		return StoredToken{}, fmt.Errorf("account %s not found", accountID)
+	}
+	if err != nil {
+		return StoredToken{}, fmt.Errorf("error reading token from postgres: %v", err)
+	}
+	if expiresAt.Valid {
+		tok.ExpiresAt = expiresAt.Time
+	}
+	if firstIssuedAt.Valid {
+		tok.FirstIssuedAt = firstIssuedAt.Time
+	}
+	return tok, nil
+}
+
+func (s *PostgresStore) DeleteToken(ctx context.Context, accountID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM instatokend_tokens WHERE account_id = $1`, accountID)
+	if err != nil {
+		return fmt.Errorf("error deleting token from postgres: %v", err)
+	}
+	return nil
+}
+
+// Watch polls instatokend_tokens since Postgres has no push primitive as
+// lightweight as etcd's watch; pollInterval bounds how stale a standby's view
+// of a peer's refresh can be.
+func (s *PostgresStore) Watch(ctx context.Context) (<-chan TokenUpdate, error) {
+	updates := make(chan TokenUpdate)
+	seen := make(map[string]string)
+
+	go func() {
+		defer close(updates)
+
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				current, err := s.LoadAll(ctx)
+				if err != nil {
+					log.Printf("Error polling postgres for token updates: %v", err)
+					continue
+				}
+				for accountID, tok := range current {
+					if seen[accountID] == tok.Token {
+						continue
+					}
+					seen[accountID] = tok.Token
+					select {
+					case updates <- TokenUpdate{AccountID: accountID, Token: tok}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return updates, nil
+}
+
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// WebhookTarget is one outbound destination for lifecycle events, configured
+// under config.json's "webhooks" array.
+type WebhookTarget struct {
+	URL    string      `json:"url"`
+	Events []EventType `json:"events"`
+	Secret string      `json:"secret"`
+}
+
+// wants reports whether target subscribes to eventType. An empty Events list
+// means "all events".
+func (t WebhookTarget) wants(eventType EventType) bool {
+	if len(t.Events) == 0 {
+		return true
+	}
+	for _, want := range t.Events {
+		if want == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSink POSTs each event as JSON to every subscribed target, signing
+// the body with HMAC-SHA256 so receivers can verify it came from this
+// instance.
+type WebhookSink struct {
+	targets []WebhookTarget
+	client  *http.Client
+}
+
+// NewWebhookSink returns a sink that delivers to targets.
+func NewWebhookSink(targets []WebhookTarget) *WebhookSink {
+	return &WebhookSink{
+		targets: targets,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *WebhookSink) Handle(event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling event for webhook delivery: %v", err)
+		return
+	}
+
+	for _, target := range s.targets {
+		if !target.wants(event.Type) {
+			continue
+		}
+		go s.deliverWithRetry(target, body)
+	}
+}
+
+// deliverWithRetry mirrors refreshTokenWithRetry's exponential backoff so
+// webhook delivery behaves the same way token refresh does under failure.
+func (s *WebhookSink) deliverWithRetry(target WebhookTarget, body []byte) {
+	backoff := time.Second
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if err := s.deliver(target, body); err == nil {
+			return
+		} else if attempt == maxRetries-1 {
+			log.Printf("Giving up delivering webhook to %s after %d attempts: %v", target.URL, maxRetries, err)
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (s *WebhookSink) deliver(target WebhookTarget, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error building webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if target.Secret != "" {
+		req.Header.Set("X-Instatoken-Signature", signPayload(target.Secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error delivering webhook: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook target %s returned status %d", target.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}